@@ -0,0 +1,614 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ghodss/yaml"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// YAMLToJSONDecoder decodes YAML documents from an io.Reader by
+// separating individual documents. It first converts the YAML
+// body to JSON, then unmarshals the JSON.
+type YAMLToJSONDecoder struct {
+	scanner    *bufio.Scanner
+	normalize  KeyNormalizer
+	strict     bool
+	docIndex   int
+	byteOffset int64
+}
+
+// NewYAMLToJSONDecoder decodes YAML documents from the provided
+// stream in chunks by converting each document (as defined by
+// the YAML spec) into its own chunk, converting it to JSON via
+// yaml.YAMLToJSON and then passing it to json.Unmarshal.
+func NewYAMLToJSONDecoder(r io.Reader) *YAMLToJSONDecoder {
+	d := &YAMLToJSONDecoder{}
+	scanner := bufio.NewScanner(r)
+	scanner.Split(d.splitDocument)
+	d.scanner = scanner
+	return d
+}
+
+// splitDocument wraps splitYAMLDocument so the decoder can track how many
+// bytes of the stream have been consumed, which Decode uses to report the
+// byte offset of a failing document.
+func (d *YAMLToJSONDecoder) splitDocument(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = splitYAMLDocument(data, atEOF)
+	d.byteOffset += int64(advance)
+	return advance, token, err
+}
+
+// DocumentIndex returns the index (0-based) of the document that the next
+// call to Decode will read, which is also the number of documents read so
+// far.
+func (d *YAMLToJSONDecoder) DocumentIndex() int {
+	return d.docIndex
+}
+
+// ByteOffset returns how many bytes of the underlying stream have been
+// consumed so far.
+func (d *YAMLToJSONDecoder) ByteOffset() int64 {
+	return d.byteOffset
+}
+
+// WithKeyNormalization rewrites every map key produced while converting a
+// YAML document to JSON through normalize before it is matched against a
+// target Go value, so manifests can use a different casing (e.g. snake_case
+// or all lower-case) than the struct tags they decode into. It returns the
+// receiver so it can be chained off of NewYAMLToJSONDecoder.
+func (d *YAMLToJSONDecoder) WithKeyNormalization(normalize KeyNormalizer) *YAMLToJSONDecoder {
+	d.normalize = normalize
+	return d
+}
+
+// Strict makes Decode reject documents that repeat the same mapping key
+// (yaml.v2 otherwise keeps the last occurrence silently) and, when into is
+// a pointer to a struct, reject JSON fields that don't match any of its
+// members. It returns the receiver so it can be chained off of
+// NewYAMLToJSONDecoder.
+func (d *YAMLToJSONDecoder) Strict() *YAMLToJSONDecoder {
+	d.strict = true
+	return d
+}
+
+// Decode reads a YAML document as JSON from the stream or returns an error.
+// The decoding rules match json.Unmarshal, not yaml.Unmarshal. A document
+// that fails to convert or unmarshal returns a *DecodeError identifying
+// which document failed and, where it can be determined, where in the
+// document the failure occurred. Errors reading the stream itself are
+// returned as is.
+func (d *YAMLToJSONDecoder) Decode(into interface{}) error {
+	startOffset := d.byteOffset
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	index := d.docIndex
+	d.docIndex++
+
+	data, err := d.convert(d.scanner.Bytes(), index)
+	if err != nil {
+		return newDecodeError(index, startOffset, err)
+	}
+	if err := d.unmarshal(data, into); err != nil {
+		return newDecodeError(index, startOffset, err)
+	}
+	return nil
+}
+
+// convert turns a single raw YAML document into JSON, applying strict
+// duplicate-key detection and key normalization first if the caller asked
+// for them.
+func (d *YAMLToJSONDecoder) convert(raw []byte, index int) ([]byte, error) {
+	if !d.strict && d.normalize == nil {
+		return yaml.YAMLToJSON(raw)
+	}
+
+	var v interface{}
+	if d.strict {
+		parsed, err := decodeStrict(raw, index)
+		if err != nil {
+			return nil, err
+		}
+		v = parsed
+	} else {
+		if err := yamlv2.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+	}
+	if d.normalize != nil {
+		normalized, err := normalizeKeys(v, d.normalize)
+		if err != nil {
+			return nil, err
+		}
+		v = normalized
+	}
+	return json.Marshal(v)
+}
+
+// unmarshal decodes data into into, rejecting unknown JSON fields in strict
+// mode when into is a pointer to a concrete struct.
+func (d *YAMLToJSONDecoder) unmarshal(data []byte, into interface{}) error {
+	if d.strict {
+		if v := reflect.ValueOf(into); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			return dec.Decode(into)
+		}
+	}
+	return json.Unmarshal(data, into)
+}
+
+// KeyNormalizer rewrites a single map key encountered while converting a
+// YAML document to JSON.
+type KeyNormalizer func(string) string
+
+// Predefined normalizers for use with WithKeyNormalization.
+var (
+	// NormalizeCamelCase rewrites snake_case, kebab-case or space separated
+	// keys to camelCase, e.g. "api_version" -> "apiVersion", and lower-cases
+	// the first rune of already-camel or Pascal-cased keys.
+	NormalizeCamelCase KeyNormalizer = normalizeCamelCase
+	// NormalizeSnakeToCamel is an alias of NormalizeCamelCase for callers
+	// that want to document the conversion being applied more explicitly.
+	NormalizeSnakeToCamel KeyNormalizer = normalizeCamelCase
+	// NormalizeCaseInsensitive lower-cases every key, so "ApiVersion" and
+	// "APIVERSION" both collapse to the same normalized key.
+	NormalizeCaseInsensitive KeyNormalizer = strings.ToLower
+)
+
+func normalizeCamelCase(key string) string {
+	var b strings.Builder
+	upperNext := false
+	for i, r := range key {
+		switch {
+		case r == '_' || r == '-' || r == ' ':
+			upperNext = true
+		case upperNext:
+			b.WriteRune(unicode.ToUpper(r))
+			upperNext = false
+		case i == 0:
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// DecodeError is returned by YAMLToJSONDecoder.Decode and
+// YAMLOrJSONDecoder.Decode when a document fails to decode, so that
+// callers streaming many documents (e.g. kubectl applying a multi-doc
+// manifest) can report exactly which one failed and where.
+type DecodeError struct {
+	// DocumentIndex is the 0-based index of the document that failed.
+	DocumentIndex int
+	// ByteOffset is the offset, in bytes from the start of the stream, of
+	// the start of the failing document.
+	ByteOffset int64
+	// Line locates the failure within the document, when the underlying
+	// error text names a line. Column is not populated by this package and
+	// is always zero.
+	Line, Column int
+	// Path is the field path of the failure (e.g. "spec.replicas"), when it
+	// can be recovered from a json unmarshal type error. For a duplicate or
+	// conflicting key it holds only that key, not the path leading to it.
+	Path string
+	// Err is the underlying error returned by the YAML or JSON layer.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("error in doc %d", e.DocumentIndex)
+	if e.Line > 0 {
+		msg = fmt.Sprintf("%s at line %d", msg, e.Line)
+	}
+	if e.Path != "" {
+		msg = fmt.Sprintf("%s, field %q", msg, e.Path)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+// Unwrap allows callers to use errors.Is/errors.As to inspect Err.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+var yamlErrorLineRE = regexp.MustCompile(`line (\d+)`)
+
+// newDecodeError wraps err, returned while decoding the document at index
+// starting at byteOffset, into a *DecodeError, recovering a line number
+// from yaml.v2's error text and a field path from json's unmarshal errors
+// when possible.
+func newDecodeError(index int, byteOffset int64, err error) *DecodeError {
+	de := &DecodeError{DocumentIndex: index, ByteOffset: byteOffset, Err: err}
+	if m := yamlErrorLineRE.FindStringSubmatch(err.Error()); m != nil {
+		if line, convErr := strconv.Atoi(m[1]); convErr == nil {
+			de.Line = line
+		}
+	}
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		de.Path = e.Field
+	case *KeyConflictError:
+		de.Path = e.Normalized
+	case *DuplicateKeyError:
+		de.Path = e.Key
+	}
+	return de
+}
+
+// DuplicateKeyError is returned by a strict YAMLToJSONDecoder when a YAML
+// mapping repeats the same key, which yaml.v2 would otherwise resolve
+// silently by keeping the last value.
+type DuplicateKeyError struct {
+	Key           string
+	DocumentIndex int
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("yaml: document %d: duplicate key %q", e.DocumentIndex, e.Key)
+}
+
+// decodeStrict decodes raw into a generic value while rejecting duplicate
+// mapping keys at every level when the document is a top-level mapping. It
+// relies on yaml.v2 preserving mapping key order and duplicates when the
+// destination is yaml.MapSlice, including for nested mappings reached
+// through an interface{} value.
+func decodeStrict(raw []byte, index int) (interface{}, error) {
+	var v interface{}
+	if err := yamlv2.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[interface{}]interface{}); !ok {
+		// The document isn't a top-level mapping (e.g. a scalar or a
+		// sequence). Mappings nested inside it are not checked for
+		// duplicate keys; their keys are only converted to strings so the
+		// result can be passed to json.Marshal.
+		return normalizeKeys(v, func(key string) string { return key })
+	}
+	var root yamlv2.MapSlice
+	if err := yamlv2.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	return checkDuplicateKeys(root, index)
+}
+
+// checkDuplicateKeys recursively converts a tree that may contain
+// yaml.MapSlice nodes (as produced by decodeStrict) into one built from
+// map[string]interface{} and []interface{}, failing if any mapping node
+// repeats a key.
+func checkDuplicateKeys(v interface{}, index int) (interface{}, error) {
+	switch t := v.(type) {
+	case yamlv2.MapSlice:
+		out := make(map[string]interface{}, len(t))
+		for _, item := range t {
+			key := fmt.Sprintf("%v", item.Key)
+			if _, ok := out[key]; ok {
+				return nil, &DuplicateKeyError{Key: key, DocumentIndex: index}
+			}
+			val, err := checkDuplicateKeys(item.Value, index)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = val
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			val, err := checkDuplicateKeys(item, index)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// KeyConflictError is returned by a YAMLToJSONDecoder using key
+// normalization when two differently-spelled keys in the same mapping
+// normalize to the same key, which would otherwise silently drop one of
+// them.
+type KeyConflictError struct {
+	Keys       []string
+	Normalized string
+}
+
+func (e *KeyConflictError) Error() string {
+	return fmt.Sprintf("yaml: keys %q all normalize to %q", e.Keys, e.Normalized)
+}
+
+// normalizeKeys recursively rewrites the keys of every map found in v using
+// normalize, converting map[interface{}]interface{} nodes (as produced by
+// yaml.v2) into map[string]interface{} along the way so the result can be
+// passed to json.Marshal.
+func normalizeKeys(v interface{}, normalize KeyNormalizer) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		source := make(map[string]string, len(t))
+		for k, val := range t {
+			key := fmt.Sprintf("%v", k)
+			norm := normalize(key)
+			if prev, ok := source[norm]; ok {
+				return nil, &KeyConflictError{Keys: []string{prev, key}, Normalized: norm}
+			}
+			source[norm] = key
+			nv, err := normalizeKeys(val, normalize)
+			if err != nil {
+				return nil, err
+			}
+			out[norm] = nv
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		source := make(map[string]string, len(t))
+		for key, val := range t {
+			norm := normalize(key)
+			if prev, ok := source[norm]; ok {
+				return nil, &KeyConflictError{Keys: []string{prev, key}, Normalized: norm}
+			}
+			source[norm] = key
+			nv, err := normalizeKeys(val, normalize)
+			if err != nil {
+				return nil, err
+			}
+			out[norm] = nv
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			nv, err := normalizeKeys(item, normalize)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = nv
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// decoder is satisfied by both YAMLToJSONDecoder and json.Decoder, allowing
+// YAMLOrJSONDecoder to defer to whichever it picked once it has sniffed the
+// stream.
+type decoder interface {
+	Decode(into interface{}) error
+}
+
+// FormatDetector inspects the start of a stream and, if it recognizes the
+// format, returns a decoder ready to consume it. peek is the buffered
+// prefix of the stream (up to the detecting YAMLOrJSONDecoder's buffer
+// size); r replays those same bytes followed by the rest of the stream, so
+// a matched detector can read it from the beginning. When a detector
+// declines by returning matched == false, it must not have consumed
+// anything from r, so the next detector in the registry still sees the
+// full stream.
+type FormatDetector interface {
+	Detect(peek []byte, r io.Reader) (dec decoder, matched bool)
+}
+
+// FormatDetectorFunc adapts a function to a FormatDetector.
+type FormatDetectorFunc func(peek []byte, r io.Reader) (decoder, bool)
+
+// Detect calls f.
+func (f FormatDetectorFunc) Detect(peek []byte, r io.Reader) (decoder, bool) {
+	return f(peek, r)
+}
+
+// DecoderRegistry holds an ordered list of FormatDetectors that
+// NewMultiFormatDecoder consults, in order, to pick a decoder for a stream.
+type DecoderRegistry struct {
+	detectors []FormatDetector
+}
+
+// NewDecoderRegistry returns an empty registry; use Register to populate it.
+func NewDecoderRegistry() *DecoderRegistry {
+	return &DecoderRegistry{}
+}
+
+// Register appends d to the end of the registry, giving it lower priority
+// than any detector already registered.
+func (r *DecoderRegistry) Register(d FormatDetector) {
+	r.detectors = append(r.detectors, d)
+}
+
+// DefaultRegistry recognizes JSON, by sniffing a leading '{', and falls
+// back to YAML for everything else, matching the historical behavior of
+// YAMLOrJSONDecoder. Callers can Register additional detectors on it, or
+// build their own DecoderRegistry and pass it to NewMultiFormatDecoder.
+var DefaultRegistry = NewDecoderRegistry()
+
+func init() {
+	DefaultRegistry.Register(FormatDetectorFunc(detectJSON))
+	DefaultRegistry.Register(FormatDetectorFunc(detectYAML))
+}
+
+func detectJSON(peek []byte, r io.Reader) (decoder, bool) {
+	if !hasJSONPrefix(peek) {
+		return nil, false
+	}
+	return json.NewDecoder(r), true
+}
+
+func detectYAML(peek []byte, r io.Reader) (decoder, bool) {
+	return NewYAMLToJSONDecoder(r), true
+}
+
+// YAMLOrJSONDecoder attempts to decode a stream of JSON documents or
+// YAML documents by consulting a DecoderRegistry of FormatDetectors,
+// defaulting to DefaultRegistry (JSON, sniffed by a leading open brace,
+// falling back to YAML).
+type YAMLOrJSONDecoder struct {
+	r          io.Reader
+	bufferSize int
+	registry   *DecoderRegistry
+	normalize  KeyNormalizer
+
+	decoder  decoder
+	jsonDec  *json.Decoder
+	docIndex int
+}
+
+// NewYAMLOrJSONDecoder returns a decoder that will process YAML documents
+// or JSON documents from the given reader as a stream. bufferSize determines
+// how far into the stream the decoder will look to figure out whether this
+// is a JSON stream (has leading whitespace followed by an open brace). It is
+// a thin wrapper around NewMultiFormatDecoder using DefaultRegistry.
+func NewYAMLOrJSONDecoder(r io.Reader, bufferSize int) *YAMLOrJSONDecoder {
+	return NewMultiFormatDecoder(r, bufferSize, DefaultRegistry)
+}
+
+// NewMultiFormatDecoder returns a decoder that picks its underlying decoder
+// by offering each FormatDetector in registry, in order, a peek at up to
+// bufferSize bytes of r.
+func NewMultiFormatDecoder(r io.Reader, bufferSize int, registry *DecoderRegistry) *YAMLOrJSONDecoder {
+	return &YAMLOrJSONDecoder{
+		r:          r,
+		bufferSize: bufferSize,
+		registry:   registry,
+	}
+}
+
+// WithKeyNormalization enables key normalization on the underlying
+// YAMLToJSONDecoder if and when the stream turns out to be YAML; JSON input
+// is never normalized, since its keys are already exact. It returns the
+// receiver so it can be chained off of NewYAMLOrJSONDecoder.
+func (d *YAMLOrJSONDecoder) WithKeyNormalization(normalize KeyNormalizer) *YAMLOrJSONDecoder {
+	d.normalize = normalize
+	return d
+}
+
+// Decode unmarshals the next object from the underlying stream into the
+// provided object, or returns an error. When the stream turns out to be
+// YAML, decode failures are returned as a *DecodeError from the underlying
+// YAMLToJSONDecoder; for a JSON stream, Decode wraps json's own errors into
+// a *DecodeError using json.Decoder's input offset.
+func (d *YAMLOrJSONDecoder) Decode(into interface{}) error {
+	if d.decoder == nil {
+		buffer := bufio.NewReaderSize(d.r, d.bufferSize)
+		peek, _ := buffer.Peek(d.bufferSize)
+
+		for _, det := range d.registry.detectors {
+			dec, matched := det.Detect(peek, buffer)
+			if !matched {
+				continue
+			}
+			if jd, ok := dec.(*json.Decoder); ok {
+				d.jsonDec = jd
+			} else if yd, ok := dec.(*YAMLToJSONDecoder); ok && d.normalize != nil {
+				yd.WithKeyNormalization(d.normalize)
+			}
+			d.decoder = dec
+			break
+		}
+		if d.decoder == nil {
+			return fmt.Errorf("yaml: no registered format detector matched the input")
+		}
+	}
+	if d.jsonDec == nil {
+		// A YAMLToJSONDecoder already returns *DecodeError; errors from
+		// other registered decoders are returned as is.
+		return d.decoder.Decode(into)
+	}
+	startOffset := d.jsonDec.InputOffset()
+	index := d.docIndex
+	d.docIndex++
+	if err := d.jsonDec.Decode(into); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return newDecodeError(index, startOffset, err)
+	}
+	return nil
+}
+
+const yamlSeparator = "\n---"
+
+// splitYAMLDocument is a bufio.SplitFunc for splitting a YAML stream into
+// individual documents, each delimited by a line containing only "---".
+func splitYAMLDocument(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	sep := len(yamlSeparator)
+	if i := bytes.Index(data, []byte(yamlSeparator)); i >= 0 {
+		// We have a potential document terminator.
+		i += sep
+		after := data[i:]
+		if len(after) == 0 {
+			// We can't tell if there's more data after the separator yet.
+			if atEOF {
+				return len(data), data[:i-sep], nil
+			}
+			return 0, nil, nil
+		}
+		if j := bytes.IndexByte(after, '\n'); j >= 0 {
+			return i + j + 1, data[0 : i-sep], nil
+		}
+		return 0, nil, nil
+	}
+	// If we're at EOF, we have a final, non-terminated document.
+	if atEOF {
+		return len(data), data, nil
+	}
+	// Request more data.
+	return 0, nil, nil
+}
+
+var jsonPrefix = []byte("{")
+
+// hasPrefix returns true if the first non-whitespace bytes in buf match
+// prefix.
+func hasPrefix(buf, prefix []byte) bool {
+	trim := bytes.TrimLeftFunc(buf, unicode.IsSpace)
+	return bytes.HasPrefix(trim, prefix)
+}
+
+func hasJSONPrefix(buf []byte) bool {
+	return hasPrefix(buf, jsonPrefix)
+}
+
+// guessJSONStream scans the provided reader up to size, looking for an open
+// brace indicating this is JSON. It returns a reader that replays the bytes
+// it peeked at so no data already sniffed is lost to the caller.
+func guessJSONStream(r io.Reader, size int) (io.Reader, bool) {
+	buffer := bufio.NewReaderSize(r, size)
+	b, _ := buffer.Peek(size)
+	return buffer, hasJSONPrefix(b)
+}
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
@@ -127,6 +128,215 @@ stuff: 1
 
 type generic map[string]interface{}
 
+func TestYAMLToJSONDecoderKeyNormalization(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`api_version: v1
+nested:
+  some-field: 1
+`))).WithKeyNormalization(NormalizeCamelCase)
+	obj := generic{}
+	if err := s.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj["apiVersion"] != "v1" {
+		t.Fatalf("unexpected object: %#v", obj)
+	}
+	nested, ok := obj["nested"].(map[string]interface{})
+	if !ok || nested["someField"] != float64(1) {
+		t.Fatalf("unexpected nested object: %#v", obj["nested"])
+	}
+}
+
+func TestYAMLToJSONDecoderKeyNormalizationConflict(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`api_version: v1
+apiVersion: v2
+`))).WithKeyNormalization(NormalizeCamelCase)
+	obj := generic{}
+	err := s.Decode(&obj)
+	var conflictErr *KeyConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a KeyConflictError, got %#v", err)
+	}
+}
+
+func TestDecodeErrorMultiDocumentYAML(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`foo: bar
+---
+foo: [
+`)))
+	obj := generic{}
+	if err := s.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error on first document: %v", err)
+	}
+	err := s.Decode(&obj)
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("expected a *DecodeError, got %#v", err)
+	}
+	if decErr.DocumentIndex != 1 {
+		t.Fatalf("expected the second document (index 1) to fail, got %d", decErr.DocumentIndex)
+	}
+	if decErr.ByteOffset == 0 {
+		t.Fatalf("expected a non-zero byte offset for the second document")
+	}
+}
+
+func TestDecodeErrorJSONStream(t *testing.T) {
+	s := NewYAMLOrJSONDecoder(bytes.NewReader([]byte(`{"foo":"bar"}{`)), 10)
+	obj := generic{}
+	if err := s.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error on first document: %v", err)
+	}
+	err := s.Decode(&obj)
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("expected a *DecodeError, got %#v", err)
+	}
+	if decErr.DocumentIndex != 1 {
+		t.Fatalf("expected the second document (index 1) to fail, got %d", decErr.DocumentIndex)
+	}
+}
+
+func TestDecodeErrorFieldPath(t *testing.T) {
+	type spec struct {
+		Replicas int `json:"replicas"`
+	}
+	type obj struct {
+		Spec spec `json:"spec"`
+	}
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`spec:
+  replicas: not-a-number
+`)))
+	var out obj
+	err := s.Decode(&out)
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("expected a *DecodeError, got %#v", err)
+	}
+	if decErr.Path == "" {
+		t.Errorf("expected a non-empty field path identifying the bad field")
+	}
+}
+
+func TestYAMLToJSONDecoderStrictDuplicateKey(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`replicas: 1
+replicas: 2
+`))).Strict()
+	obj := generic{}
+	err := s.Decode(&obj)
+	decErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("expected a *DecodeError, got %#v", err)
+	}
+	if _, ok := decErr.Err.(*DuplicateKeyError); !ok {
+		t.Fatalf("expected a *DuplicateKeyError, got %#v", decErr.Err)
+	}
+}
+
+func TestYAMLToJSONDecoderStrictDuplicateKeyNested(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`spec:
+  replicas: 1
+  replicas: 2
+`))).Strict()
+	obj := generic{}
+	if err := s.Decode(&obj); err == nil {
+		t.Fatalf("expected a duplicate key error for the nested mapping")
+	}
+}
+
+func TestYAMLToJSONDecoderStrictUnknownField(t *testing.T) {
+	type spec struct {
+		Replicas int `json:"replicas"`
+	}
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`replicas: 1
+bogus: true
+`))).Strict()
+	var out spec
+	if err := s.Decode(&out); err == nil {
+		t.Fatalf("expected an unknown field error")
+	}
+}
+
+func TestYAMLToJSONDecoderStrictAllowsGenericTargets(t *testing.T) {
+	s := NewYAMLToJSONDecoder(bytes.NewReader([]byte(`replicas: 1
+`))).Strict()
+	obj := generic{}
+	if err := s.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error decoding into a map target: %v", err)
+	}
+}
+
+// csvDecoder is a minimal example of a third-party decoder plugged into a
+// DecoderRegistry: it treats each line of the stream as a single-field
+// document.
+type csvDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func (d *csvDecoder) Decode(into interface{}) error {
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	out, ok := into.(*generic)
+	if !ok {
+		return fmt.Errorf("csvDecoder: unsupported target %T", into)
+	}
+	*out = generic{"line": d.scanner.Text()}
+	return nil
+}
+
+func detectCSV(peek []byte, r io.Reader) (decoder, bool) {
+	if !bytes.HasPrefix(peek, []byte("csv:")) {
+		return nil, false
+	}
+	return &csvDecoder{scanner: bufio.NewScanner(r)}, true
+}
+
+func TestMultiFormatDecoderCustomDetector(t *testing.T) {
+	registry := NewDecoderRegistry()
+	registry.Register(FormatDetectorFunc(detectCSV))
+	registry.Register(FormatDetectorFunc(detectJSON))
+	registry.Register(FormatDetectorFunc(detectYAML))
+
+	decoder := NewMultiFormatDecoder(bytes.NewReader([]byte("csv:\nfoo\n")), 10, registry)
+	obj := generic{}
+	if err := decoder.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj["line"] != "csv:" {
+		t.Fatalf("unexpected object: %#v", obj)
+	}
+}
+
+func TestMultiFormatDecoderFallsBackToYAML(t *testing.T) {
+	registry := NewDecoderRegistry()
+	registry.Register(FormatDetectorFunc(detectCSV))
+	registry.Register(FormatDetectorFunc(detectJSON))
+	registry.Register(FormatDetectorFunc(detectYAML))
+
+	decoder := NewMultiFormatDecoder(bytes.NewReader([]byte("foo: bar")), 10, registry)
+	obj := generic{}
+	if err := decoder.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj["foo"] != "bar" {
+		t.Fatalf("unexpected object: %#v", obj)
+	}
+}
+
+func TestYAMLOrJSONDecoderSkipsNormalizationForJSON(t *testing.T) {
+	s := NewYAMLOrJSONDecoder(bytes.NewReader([]byte(`{"api_version":"v1"}`)), 10).WithKeyNormalization(NormalizeCamelCase)
+	obj := generic{}
+	if err := s.Decode(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj["api_version"] != "v1" {
+		t.Fatalf("expected JSON keys to be left alone, got: %#v", obj)
+	}
+}
+
 func TestYAMLOrJSONDecoder(t *testing.T) {
 	testCases := []struct {
 		input  string
@@ -0,0 +1,143 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// MultiDocumentYAMLEncoder writes a sequence of Go values to the underlying
+// writer as a stream of YAML documents separated by "---", the inverse of
+// the document splitting performed by YAMLToJSONDecoder.
+type MultiDocumentYAMLEncoder struct {
+	w         io.Writer
+	canonical bool
+	wrote     bool
+}
+
+// NewMultiDocumentYAMLEncoder returns an encoder that writes each value
+// passed to Encode to w as its own YAML document.
+func NewMultiDocumentYAMLEncoder(w io.Writer) *MultiDocumentYAMLEncoder {
+	return &MultiDocumentYAMLEncoder{w: w}
+}
+
+// Canonical controls whether struct fields, like map keys, are emitted in
+// sorted order so that repeated encodes of equivalent objects produce
+// byte-identical output, which kubectl-style diffing depends on. Map keys
+// are sorted either way; with Canonical off, struct fields keep their
+// declared order. It is off by default.
+func (e *MultiDocumentYAMLEncoder) Canonical(canonical bool) *MultiDocumentYAMLEncoder {
+	e.canonical = canonical
+	return e
+}
+
+// Encode writes obj to the stream as a new YAML document.
+func (e *MultiDocumentYAMLEncoder) Encode(obj interface{}) error {
+	data, err := e.marshal(obj)
+	if err != nil {
+		return err
+	}
+	if e.wrote {
+		if _, err := io.WriteString(e.w, "---\n"); err != nil {
+			return err
+		}
+	}
+	e.wrote = true
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		if _, err := io.WriteString(e.w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *MultiDocumentYAMLEncoder) marshal(obj interface{}) ([]byte, error) {
+	if !e.canonical {
+		// yaml.v2 preserves a struct's declared field order; it only
+		// imposes a (sorted) order on maps, since Go's own map iteration
+		// order is randomized and some order has to be picked.
+		return yamlv2.Marshal(obj)
+	}
+	// Route through JSON and back into a generic value first: json.Marshal
+	// drops obj's concrete struct type, so the resulting map's keys get
+	// sorted like any other map when yaml.v2 marshals it, giving a
+	// canonical, diff-stable document regardless of obj's declared field
+	// order.
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return yamlv2.Marshal(generic)
+}
+
+// YAMLOrJSONEncoder writes a sequence of Go values to the underlying writer
+// as either concatenated JSON documents or a "---"-separated YAML stream,
+// the write-side counterpart of YAMLOrJSONDecoder's format sniffing.
+type YAMLOrJSONEncoder struct {
+	yaml *MultiDocumentYAMLEncoder
+	json *json.Encoder
+}
+
+// NewYAMLOrJSONEncoder returns an encoder that writes to w in the requested
+// format. When asJSON is false the stream is YAML documents separated by
+// "---"; when true it is concatenated JSON documents.
+func NewYAMLOrJSONEncoder(w io.Writer, asJSON bool) *YAMLOrJSONEncoder {
+	if asJSON {
+		return &YAMLOrJSONEncoder{json: json.NewEncoder(w)}
+	}
+	return &YAMLOrJSONEncoder{yaml: NewMultiDocumentYAMLEncoder(w)}
+}
+
+// Indent sets the indent width used for pretty-printed JSON output. It has
+// no effect when the encoder is writing YAML.
+func (e *YAMLOrJSONEncoder) Indent(spaces int) *YAMLOrJSONEncoder {
+	if e.json != nil {
+		e.json.SetIndent("", strings.Repeat(" ", spaces))
+	}
+	return e
+}
+
+// Canonical controls whether keys are emitted in sorted order so repeated
+// encodes of equivalent objects produce byte-identical output. It applies
+// only to YAML output; JSON output always has sorted map keys and struct
+// fields in their declared order, whatever Canonical is set to.
+func (e *YAMLOrJSONEncoder) Canonical(canonical bool) *YAMLOrJSONEncoder {
+	if e.yaml != nil {
+		e.yaml.Canonical(canonical)
+	}
+	return e
+}
+
+// Encode writes obj to the stream as a new document in whichever format the
+// encoder was constructed with.
+func (e *YAMLOrJSONEncoder) Encode(obj interface{}) error {
+	if e.yaml != nil {
+		return e.yaml.Encode(obj)
+	}
+	return e.json.Encode(obj)
+}
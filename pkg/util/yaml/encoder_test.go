@@ -0,0 +1,85 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMultiDocumentYAMLEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewMultiDocumentYAMLEncoder(buf)
+	if err := enc.Encode(generic{"a": "b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enc.Encode(generic{"c": "d"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoder := NewYAMLToJSONDecoder(bytes.NewReader(buf.Bytes()))
+	first, second := generic{}, generic{}
+	if err := decoder.Decode(&first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := decoder.Decode(&second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first["a"] != "b" || second["c"] != "d" {
+		t.Fatalf("unexpected round trip: %#v %#v", first, second)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("---\n")) {
+		t.Fatalf("expected a document separator: %q", buf.String())
+	}
+}
+
+func TestMultiDocumentYAMLEncoderCanonical(t *testing.T) {
+	type pair struct {
+		Z int `json:"z"`
+		A int `json:"a"`
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewMultiDocumentYAMLEncoder(buf).Encode(pair{Z: 1, A: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := buf.String(), "z: 1\na: 2\n"; got != want {
+		t.Fatalf("expected declared field order to be preserved by default, got %q want %q", got, want)
+	}
+
+	buf.Reset()
+	if err := NewMultiDocumentYAMLEncoder(buf).Canonical(true).Encode(pair{Z: 1, A: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := buf.String(), "a: 2\nz: 1\n"; got != want {
+		t.Fatalf("expected canonical mode to sort keys, got %q want %q", got, want)
+	}
+}
+
+func TestYAMLOrJSONEncoderJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewYAMLOrJSONEncoder(buf, true)
+	if err := enc.Encode(generic{"a": "b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enc.Encode(generic{"c": "d"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := buf.String(), "{\"a\":\"b\"}\n{\"c\":\"d\"}\n"; got != want {
+		t.Fatalf("unexpected output: %q want %q", got, want)
+	}
+}